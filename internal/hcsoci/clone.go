@@ -9,6 +9,7 @@ import (
 	"github.com/Microsoft/hcsshim/internal/cow"
 	"github.com/Microsoft/hcsshim/internal/requesttype"
 	hcsschema "github.com/Microsoft/hcsshim/internal/schema2"
+	"github.com/Microsoft/hcsshim/internal/uvm"
 )
 
 const (
@@ -16,13 +17,100 @@ const (
 	MappedPipeResourcePath      = "Container/MappedPipes"
 )
 
+// errIncompatibleClonedMounts is returned when a cloned container's explicit
+// mount request redefines a container path that the template container
+// already mapped to a different host path. The template's mount is
+// authoritative for the paths it claims, since the clone's root filesystem
+// was captured from the template with those paths already in place.
+type errIncompatibleClonedMounts struct {
+	containerPath string
+}
+
+func (e *errIncompatibleClonedMounts) Error() string {
+	return fmt.Sprintf("clone mount request for container path %q is incompatible with the template's mount set", e.containerPath)
+}
+
+// mergeCloneMounts validates `cloneMounts` (the mounts explicitly requested
+// for a cloned container) against `templateMounts` (the mounts the template
+// container was created with, persisted alongside the saved UVM state) and
+// returns the combined set to apply to the clone. A clone may add mounts at
+// container paths the template didn't use; it may not redefine one of the
+// template's paths to a different host path.
+func mergeCloneMounts(templateMounts, cloneMounts *mountsConfig) (*mountsConfig, error) {
+	merged := &mountsConfig{}
+	seen := make(map[string]string)
+
+	for _, md := range templateMounts.mdsv2 {
+		seen[md.ContainerPath] = md.HostPath
+		merged.mdsv2 = append(merged.mdsv2, md)
+	}
+	for _, mp := range templateMounts.mpsv2 {
+		seen[mp.ContainerPath] = mp.HostPath
+		merged.mpsv2 = append(merged.mpsv2, mp)
+	}
+
+	for _, md := range cloneMounts.mdsv2 {
+		if hostPath, ok := seen[md.ContainerPath]; ok {
+			if hostPath != md.HostPath {
+				return nil, &errIncompatibleClonedMounts{containerPath: md.ContainerPath}
+			}
+			continue
+		}
+		merged.mdsv2 = append(merged.mdsv2, md)
+	}
+	for _, mp := range cloneMounts.mpsv2 {
+		if hostPath, ok := seen[mp.ContainerPath]; ok {
+			if hostPath != mp.HostPath {
+				return nil, &errIncompatibleClonedMounts{containerPath: mp.ContainerPath}
+			}
+			continue
+		}
+		merged.mpsv2 = append(merged.mpsv2, mp)
+	}
+
+	return merged, nil
+}
+
+// AddClonedContainerMounts merges the mounts the template container was
+// created with (`templateMounts`) with any mounts explicitly requested for
+// the clone (`cloneMounts`), validates the two sets are compatible, and adds
+// the combined set to `c` via Modify requests.
+func AddClonedContainerMounts(ctx context.Context, c cow.Container, templateMounts, cloneMounts *mountsConfig) error {
+	merged, err := mergeCloneMounts(templateMounts, cloneMounts)
+	if err != nil {
+		return err
+	}
+	return addMountsToClone(ctx, c, merged)
+}
+
+// AddClonedContainerMountsForTemplate looks up the mounts `templateID`'s
+// template container was created with (see uvm.RegisterTemplateMounts) and
+// merges them with `cloneMounts` before adding the combined set to `c`. If
+// the template has no registered mounts, `cloneMounts` is added as-is.
+//
+// This is the intended call site for the clone-container creation path once
+// a clone is instantiated from `templateID`; nothing in this checkout's
+// clone path calls it yet (that entrypoint lives outside the files present
+// here), so it's reachable only by calling it directly until that wiring
+// exists.
+func AddClonedContainerMountsForTemplate(ctx context.Context, c cow.Container, templateID string, cloneMounts *mountsConfig) error {
+	tm, ok := uvm.GetTemplateMounts(templateID)
+	if !ok {
+		return addMountsToClone(ctx, c, cloneMounts)
+	}
+	templateMounts := &mountsConfig{mdsv2: tm.MappedDirectories, mpsv2: tm.MappedPipes}
+	return AddClonedContainerMounts(ctx, c, templateMounts, cloneMounts)
+}
+
 // Usually mounts specified in the container config are added in the container doc
 // that is passed along with the container creation reuqest. However, for cloned containers
 // we don't send any create container request so we must add the mounts one by one by
 // doing Modify requests to that container.
 func addMountsToClone(ctx context.Context, c cow.Container, mounts *mountsConfig) error {
-	// TODO(ambarve) : Find out if there is a way to send request for all the mounts
-	// at the same time to save time
+	if len(mounts.mdsv2) == 0 && len(mounts.mpsv2) == 0 {
+		return nil
+	}
+
 	for _, md := range mounts.mdsv2 {
 		requestDocument := &hcsschema.ModifySettingRequest{
 			RequestType:  requesttype.Add,
@@ -10,6 +10,38 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// isDefaultGatewayEndpoint reports whether `endpoint` is the designated
+// default-gateway endpoint for an overlay network: an HNS endpoint flagged
+// EnableInternalDNS-only with a GatewayAddress, rather than a regular
+// container-facing endpoint. Overlay networks need an L2 bridge endpoint like
+// this to source the namespace's default route.
+func isDefaultGatewayEndpoint(endpoint *hns.HNSEndpoint) bool {
+	return endpoint.EnableInternalDNS && endpoint.GatewayAddress != ""
+}
+
+// sortEndpointIDsDefaultGatewayLast returns `endpointIDs` reordered so that
+// the default-gateway endpoint, if any, is added to the namespace last. HNS
+// sources a namespace's default route from whichever endpoint claims it most
+// recently, so the gateway endpoint must not be superseded by a later add.
+func sortEndpointIDsDefaultGatewayLast(ctx context.Context, endpointIDs []string) []string {
+	sorted := make([]string, 0, len(endpointIDs))
+	var gatewayEndpointIDs []string
+	for _, endpointID := range endpointIDs {
+		endpoint, err := hns.GetHNSEndpointByID(endpointID)
+		if err != nil {
+			log.G(ctx).WithField("endpointID", endpointID).WithError(err).Warn("failed to look up endpoint while sorting for default gateway")
+			sorted = append(sorted, endpointID)
+			continue
+		}
+		if isDefaultGatewayEndpoint(endpoint) {
+			gatewayEndpointIDs = append(gatewayEndpointIDs, endpointID)
+		} else {
+			sorted = append(sorted, endpointID)
+		}
+	}
+	return append(sorted, gatewayEndpointIDs...)
+}
+
 func createNetworkNamespace(ctx context.Context, coi *createOptionsInternal, resources *Resources) error {
 	op := "hcsoci::createNetworkNamespace"
 	l := log.G(ctx).WithField(logfields.ContainerID, coi.ID)
@@ -29,7 +61,8 @@ func createNetworkNamespace(ctx context.Context, coi *createOptionsInternal, res
 	resources.netNS = netID
 	resources.createdNetNS = true
 	endpoints := make([]string, 0)
-	for _, endpointID := range coi.Spec.Windows.Network.EndpointList {
+	orderedEndpointIDs := sortEndpointIDsDefaultGatewayLast(ctx, coi.Spec.Windows.Network.EndpointList)
+	for _, endpointID := range orderedEndpointIDs {
 		err = hns.AddNamespaceEndpoint(netID, endpointID)
 		if err != nil {
 			return err
@@ -44,6 +77,27 @@ func createNetworkNamespace(ctx context.Context, coi *createOptionsInternal, res
 	return nil
 }
 
+// ResolveDefaultGatewayEndpoint returns the endpoint in `resources`' network
+// namespace that's designated to carry the namespace's default route (see
+// isDefaultGatewayEndpoint), or nil if none of the namespace's endpoints are
+// flagged that way. Nothing in this package calls it; SetupNetworkNamespace
+// finds the gateway endpoint itself.
+func (resources *Resources) ResolveDefaultGatewayEndpoint(ctx context.Context) (*hns.HNSEndpoint, error) {
+	if resources.netNS == "" {
+		return nil, nil
+	}
+	endpoints, err := GetNamespaceEndpoints(ctx, resources.netNS)
+	if err != nil {
+		return nil, err
+	}
+	for _, endpoint := range endpoints {
+		if isDefaultGatewayEndpoint(endpoint) {
+			return endpoint, nil
+		}
+	}
+	return nil, nil
+}
+
 // GetNamespaceEndpoints gets all endpoints in `netNS`
 func GetNamespaceEndpoints(ctx context.Context, netNS string) ([]*hns.HNSEndpoint, error) {
 	op := "hcsoci::GetNamespaceEndpoints"
@@ -86,5 +140,18 @@ func SetupNetworkNamespace(ctx context.Context, hostingSystem *uvm.UtilityVM, ns
 		hostingSystem.RemoveNetNS(ctx, nsid)
 		return err
 	}
+
+	for _, endpoint := range endpoints {
+		if !isDefaultGatewayEndpoint(endpoint) {
+			continue
+		}
+		if err = hostingSystem.SetDefaultGatewayEndpoint(ctx, nsid, endpoint.Id, endpoint.GatewayAddress); err != nil {
+			// Best effort clean up the NS
+			hostingSystem.RemoveNetNS(ctx, nsid)
+			return err
+		}
+		break
+	}
+
 	return nil
 }
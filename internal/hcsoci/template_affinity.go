@@ -0,0 +1,39 @@
+// +build windows
+
+package hcsoci
+
+import (
+	"github.com/Microsoft/hcsshim/internal/uvm"
+)
+
+// AnnotationTemplateID is the pod/container annotation naming the template a
+// clone request should be created from.
+const AnnotationTemplateID = "io.microsoft.virtualmachine.templateid"
+
+// AnnotationTemplateAffinity is the pod/container annotation controlling
+// whether a clone request requires its template to already be present on
+// this node (see uvm.TemplateAffinity).
+const AnnotationTemplateAffinity = "io.microsoft.virtualmachine.templateaffinity"
+
+// ValidateTemplateAffinity calls uvm.CheckTemplateAffinity against a clone
+// request's annotations: a request carrying
+// AnnotationTemplateAffinity=required for a templateid this node hasn't
+// registered (see uvm.RegisterTemplate) fails with uvm.ErrTemplateNotFound
+// instead of proceeding to clone against nothing.
+//
+// A request with no AnnotationTemplateID, or an affinity other than
+// "required", always passes - the annotation is otherwise advisory only.
+//
+// This is the intended call site for the pod-creation path, to be called
+// with a clone request's annotations before provisioning the clone's UVM.
+// Nothing in this checkout's pod-creation path calls it yet (that entrypoint
+// lives outside the files present here), so until it's wired in, it's
+// reachable only by calling it directly.
+func ValidateTemplateAffinity(annotations map[string]string) error {
+	templateID := annotations[AnnotationTemplateID]
+	if templateID == "" {
+		return nil
+	}
+	affinity := uvm.TemplateAffinity(annotations[AnnotationTemplateAffinity])
+	return uvm.CheckTemplateAffinity(templateID, affinity)
+}
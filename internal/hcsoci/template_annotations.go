@@ -0,0 +1,19 @@
+// +build windows
+
+package hcsoci
+
+// IsSaveAsTemplateRequested reports whether `annotations` requested the
+// owning container's UVM be saved as a template once the container exits
+// (see AnnotationSaveAsTemplate). It has no WCOW/LCOW-specific logic of its
+// own - HandleContainerExit is what actually performs the save, and it works
+// identically for both since the underlying HCS save/restore mechanism isn't
+// OS-specific.
+func IsSaveAsTemplateRequested(annotations map[string]string) bool {
+	return annotations[AnnotationSaveAsTemplate] == "true"
+}
+
+// CloneTemplateID returns the templateid a clone request's annotations name
+// (see AnnotationTemplateID), or "" if the request isn't a clone.
+func CloneTemplateID(annotations map[string]string) string {
+	return annotations[AnnotationTemplateID]
+}
@@ -0,0 +1,49 @@
+// +build windows
+
+package hcsoci
+
+import (
+	"context"
+
+	"github.com/Microsoft/hcsshim/internal/uvm"
+)
+
+// AnnotationSaveAsTemplate is the pod/container annotation that requests a
+// UVM be saved as a template once its container exits.
+const AnnotationSaveAsTemplate = "io.microsoft.virtualmachine.saveastemplate"
+
+// HandleContainerExit saves `hostingSystem` as a template under `templateID`
+// (the exited container's ID) if `annotations` requested
+// AnnotationSaveAsTemplate, notifying anyone blocked in
+// uvm.WaitForSaveAsTemplate and publishing uvm.SaveAsTemplateEventTopic via
+// `publisher` once the save completes or fails.
+//
+// `mounts` is the exited container's mount set, if any; on a successful save
+// it's registered alongside the template (see uvm.RegisterTemplateMounts) so
+// AddClonedContainerMountsForTemplate can later apply the same mounts to a
+// clone without the caller having to re-derive them.
+//
+// This is the intended integration point for the shim's container-exit
+// path: once a container's init process exits, the path that owns its
+// hosting UVM should call this with that container's exit-time state.
+// Nothing in this checkout's shim entrypoint calls it yet - that wiring
+// lives outside the files present here - so until it's called from a real
+// exit path, SaveAsTemplate/WaitForSaveAsTemplate and the mount registry
+// this populates are reachable only by calling HandleContainerExit directly.
+func HandleContainerExit(ctx context.Context, templateID string, annotations map[string]string, hostingSystem *uvm.UtilityVM, mounts *mountsConfig, publisher uvm.EventPublisher) error {
+	if annotations[AnnotationSaveAsTemplate] != "true" {
+		return nil
+	}
+
+	if err := hostingSystem.SaveAsTemplate(ctx, publisher); err != nil {
+		return err
+	}
+	hostingSystem.RegisterAsTemplate(templateID)
+	if mounts != nil {
+		uvm.RegisterTemplateMounts(templateID, uvm.TemplateMounts{
+			MappedDirectories: mounts.mdsv2,
+			MappedPipes:       mounts.mpsv2,
+		})
+	}
+	return nil
+}
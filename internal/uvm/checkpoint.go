@@ -0,0 +1,333 @@
+// +build windows
+
+package uvm
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Microsoft/go-winio/pkg/guid"
+	"github.com/Microsoft/hcsshim/internal/schemaversion"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CheckpointCompression selects the compression applied to a UVM checkpoint
+// archive written by (*UtilityVM).Checkpoint.
+type CheckpointCompression int
+
+const (
+	// CheckpointCompressionZstd compresses the archive with zstd. This is
+	// the default (the zero value): a good speed/ratio tradeoff for a
+	// checkpoint meant to move to another disk.
+	CheckpointCompressionZstd CheckpointCompression = iota
+	// CheckpointCompressionNone writes the archive uncompressed - the
+	// fastest option when the archive stays on the same host.
+	CheckpointCompressionNone
+	// CheckpointCompressionGzip compresses the archive with gzip.
+	CheckpointCompressionGzip
+)
+
+const checkpointArchiveName = "checkpoint.tar"
+const checkpointManifestEntryName = "manifest.json"
+const checkpointStateEntryName = "state.json"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// checkpointManifest is the first entry in a checkpoint archive. Restore
+// reads it before touching the rest of the archive, so an incompatible
+// checkpoint is rejected up front instead of failing partway into
+// reconstructing the UVM.
+type checkpointManifest struct {
+	// HCSSchemaVersion is the HCS schema version the UVM was created with.
+	HCSSchemaVersion string `json:"hcsSchemaVersion"`
+	// GCSProtocolVersion is reserved for the negotiated GCS protocol
+	// version. Checkpoint does not record it, so it is always 0, and Restore
+	// does not check it.
+	GCSProtocolVersion uint32 `json:"gcsProtocolVersion"`
+	// Compression records which compression the archive body uses. It's
+	// informational only - Restore sniffs the magic bytes instead of
+	// trusting this field, so an archive can be restored regardless of the
+	// compression the caller requests.
+	Compression CheckpointCompression `json:"compression"`
+}
+
+// checkpointState is the UVM resource inventory persisted alongside the
+// checkpoint manifest: the original system's ID and layer folders needed to
+// rebuild an equivalent OptionsWCOW at restore time, plus the namespace
+// metadata needed to reattach network namespaces after a restore.
+type checkpointState struct {
+	ID           string   `json:"id"`
+	Owner        string   `json:"owner"`
+	LayerFolders []string `json:"layerFolders"`
+	NamespaceIDs []string `json:"namespaceIDs,omitempty"`
+}
+
+// CheckpointOptions control how (*UtilityVM).Checkpoint writes its archive.
+type CheckpointOptions struct {
+	// Compression selects the archive's compression. Defaults to
+	// CheckpointCompressionZstd if left unset.
+	Compression CheckpointCompression
+
+	// LayerFolders are the image layer paths `uvm` was created with, in the
+	// same order CreateWCOW expects. RestoreWCOWFromCheckpoint needs these to
+	// rebuild the restored instance's OptionsWCOW.
+	LayerFolders []string
+}
+
+// Checkpoint records enough of `uvm`'s identity and resource inventory
+// (namespace metadata, layer folders) into a tar archive under `dir` for
+// RestoreWCOWFromCheckpoint to later rebuild an equivalent UVM.
+//
+// Like the existing clone path, the actual saved VM state this produces
+// lives inside HCS itself, addressed by `uvm`'s own system ID - Save asks
+// HCS to persist it, and restore references it via
+// hcsschema.RestoreState.TemplateSystemId, the same mechanism CreateWCOW's
+// IsClone branch uses for RestoreState.TemplateSystemId. The archive is a
+// portable pointer plus metadata, not a raw memory dump: this package has no
+// API that exposes the saved-state bytes themselves, so unlike
+// ExportTemplate/ImportTemplate (which do carry an opaque saved-state blob
+// supplied by the caller), a checkpoint only survives as long as HCS still
+// has `uvm`'s saved system on this host - it does not survive a host reboot.
+func (uvm *UtilityVM) Checkpoint(ctx context.Context, dir string, opts CheckpointOptions) (err error) {
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %s", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, checkpointArchiveName))
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint archive: %s", err)
+	}
+	defer f.Close()
+
+	cw, err := newCompressedWriter(f, opts.Compression)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := cw.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	tw := tar.NewWriter(cw)
+	defer func() {
+		if cerr := tw.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	manifestBytes, err := json.Marshal(&checkpointManifest{
+		HCSSchemaVersion: fmt.Sprintf("%d.%d", schemaversion.SchemaV21().Major, schemaversion.SchemaV21().Minor),
+		Compression:      opts.Compression,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint manifest: %s", err)
+	}
+	if err = addTarEntry(tw, checkpointManifestEntryName, manifestBytes); err != nil {
+		return err
+	}
+
+	namespaceIDs := make([]string, 0, len(uvm.namespaces))
+	for id := range uvm.namespaces {
+		namespaceIDs = append(namespaceIDs, id)
+	}
+	stateBytes, err := json.Marshal(&checkpointState{
+		ID:           uvm.id,
+		Owner:        uvm.owner,
+		LayerFolders: opts.LayerFolders,
+		NamespaceIDs: namespaceIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint state: %s", err)
+	}
+	if err = addTarEntry(tw, checkpointStateEntryName, stateBytes); err != nil {
+		return err
+	}
+
+	if err = uvm.hcsSystem.Save(ctx, nil); err != nil {
+		return fmt.Errorf("failed to save UVM state for checkpoint: %s", err)
+	}
+
+	return nil
+}
+
+// RestoreOptions control RestoreWCOWFromCheckpoint.
+type RestoreOptions struct {
+	// Dir is the directory a prior Checkpoint call wrote its archive to.
+	Dir string
+
+	// Options supplies the fields the checkpoint archive doesn't carry (VSMB
+	// share layout, boot config, resource limits, etc.) for the restored
+	// UVM - the same *OptionsWCOW CreateWCOW takes. Its ID, Owner,
+	// LayerFolders, IsClone and TemplateConfig fields are overwritten from
+	// the checkpoint; everything else is passed through as given.
+	Options *OptionsWCOW
+}
+
+// RestoreWCOWFromCheckpoint reconstitutes a UVM from the archive a prior
+// Checkpoint call wrote to `opts.Dir`. It sniffs the archive's compression
+// from its magic bytes rather than trusting the manifest, so the archive can
+// be restored regardless of which CheckpointCompression produced it, and it
+// rejects the restore outright if the manifest's HCS schema version isn't
+// one this build understands.
+//
+// It restores by delegating to CreateWCOW with IsClone set and
+// TemplateConfig.UVMID pointing at the checkpointed system's own ID, exactly
+// as CreateWCOW's existing clone path does - this is what actually opens a
+// real compute system and sets uvm.hcsSystem, instead of a bare *UtilityVM
+// struct with no HCS handle behind it. The restored instance gets a freshly
+// generated ID of its own; `state.ID` names the original, saved system HCS
+// will restore from, not the new UVM.
+func RestoreWCOWFromCheckpoint(ctx context.Context, opts RestoreOptions) (_ *UtilityVM, err error) {
+	if opts.Options == nil {
+		return nil, fmt.Errorf("RestoreOptions.Options is required to rebuild the restored UVM's configuration")
+	}
+
+	f, err := os.Open(filepath.Join(opts.Dir, checkpointArchiveName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint archive: %s", err)
+	}
+	defer f.Close()
+
+	cr, err := newDecompressingReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(cr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint manifest entry: %s", err)
+	}
+	if hdr.Name != checkpointManifestEntryName {
+		return nil, fmt.Errorf("checkpoint archive is malformed: expected %q first, got %q", checkpointManifestEntryName, hdr.Name)
+	}
+	manifestBytes, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint manifest: %s", err)
+	}
+	var manifest checkpointManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint manifest: %s", err)
+	}
+	wantSchema := fmt.Sprintf("%d.%d", schemaversion.SchemaV21().Major, schemaversion.SchemaV21().Minor)
+	if manifest.HCSSchemaVersion != wantSchema {
+		return nil, fmt.Errorf("checkpoint archive has incompatible HCS schema version %q, this build supports %q", manifest.HCSSchemaVersion, wantSchema)
+	}
+
+	hdr, err = tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint state entry: %s", err)
+	}
+	if hdr.Name != checkpointStateEntryName {
+		return nil, fmt.Errorf("checkpoint archive is malformed: expected %q second, got %q", checkpointStateEntryName, hdr.Name)
+	}
+	stateBytes, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint state: %s", err)
+	}
+	var state checkpointState
+	if err := json.Unmarshal(stateBytes, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint state: %s", err)
+	}
+
+	restoreOpts := *opts.Options
+	restoreOpts.Owner = state.Owner
+	restoreOpts.LayerFolders = state.LayerFolders
+	restoreOpts.IsClone = true
+	restoreOpts.TemplateConfig = &UVMTemplateConfig{UVMID: state.ID}
+
+	g, err := guid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	restoreOpts.ID = g.String()
+
+	uvm, err := CreateWCOW(ctx, &restoreOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore UVM from checkpoint: %s", err)
+	}
+
+	for _, id := range state.NamespaceIDs {
+		if _, ok := uvm.namespaces[id]; !ok {
+			if uvm.namespaces == nil {
+				uvm.namespaces = make(map[string]*namespaceInfo)
+			}
+			uvm.namespaces[id] = &namespaceInfo{nics: make(map[string]*nicInfo)}
+		}
+	}
+
+	return uvm, nil
+}
+
+// newCompressedWriter wraps `w` with the io.WriteCloser matching
+// `compression`. For CheckpointCompressionNone it returns a no-op closer
+// around `w` so callers can always defer Close().
+func newCompressedWriter(w io.Writer, compression CheckpointCompression) (io.WriteCloser, error) {
+	switch compression {
+	case CheckpointCompressionNone:
+		return nopWriteCloser{w}, nil
+	case CheckpointCompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CheckpointCompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown checkpoint compression %d", compression)
+	}
+}
+
+// newDecompressingReader sniffs the magic bytes at the start of `r` and
+// returns a reader that transparently decompresses the stream, regardless of
+// which CheckpointCompression produced it.
+func newDecompressingReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, 512)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to sniff checkpoint archive: %s", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		return zstd.NewReader(br)
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	default:
+		return br, nil
+	}
+}
+
+// nopWriteCloser adapts an io.Writer to an io.WriteCloser whose Close is a
+// no-op, so Checkpoint can always `defer cw.Close()` regardless of
+// compression.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func addTarEntry(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Size: int64(len(data)),
+		Mode: 0644,
+	}); err != nil {
+		return fmt.Errorf("failed to write tar header for %q: %s", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write tar entry %q: %s", name, err)
+	}
+	return nil
+}
@@ -43,6 +43,69 @@ type OptionsWCOW struct {
 	// must be passed which holds all the information about the template from which
 	// this clone should be created.
 	TemplateConfig *UVMTemplateConfig
+
+	// CheckpointCompression is set to CheckpointCompressionZstd by
+	// NewDefaultOptionsWCOW. CreateWCOW does not store it on the UVM, and
+	// (*UtilityVM).Checkpoint does not read it: Checkpoint takes its
+	// compression from CheckpointOptions.Compression only.
+	CheckpointCompression CheckpointCompression
+
+	// Boot overrides how the UVM boots. If nil, CreateWCOW boots the UVM
+	// the default way: UEFI loading `bootmgfw.efi` off the `os` VmbFs share.
+	Boot *BootConfig
+}
+
+// BootLoaderDeviceType identifies which HCS attachment a BootConfig's
+// BootLoaderPath is read from. It is not used for DirectBoot.
+type BootLoaderDeviceType string
+
+const (
+	BootLoaderDeviceTypeVmbFs BootLoaderDeviceType = "VmbFs"
+	BootLoaderDeviceTypeScsi  BootLoaderDeviceType = "Scsi"
+	BootLoaderDeviceTypeVPMem BootLoaderDeviceType = "VPMem"
+)
+
+// BootConfig overrides the default UEFI boot of a WCOW UVM, analogous to
+// LCOW's KirdPath/BootParameters knobs. It lets downstream tooling (custom
+// debug UVM images, alternate bootloaders for template UVMs) launch without
+// patching this package.
+type BootConfig struct {
+	// BootLoaderPath is the path, relative to the device identified by
+	// BootLoaderDeviceType, of the UEFI boot loader to use in place of
+	// `\EFI\Microsoft\Boot\bootmgfw.efi`. Ignored if DirectBoot is true.
+	BootLoaderPath string
+	// BootLoaderDeviceType identifies the device BootLoaderPath is read
+	// from. Defaults to BootLoaderDeviceTypeVmbFs if empty. It is ignored
+	// when DirectBoot is true.
+	BootLoaderDeviceType BootLoaderDeviceType
+	// KernelPath is the path to a Linux-style kernel image, passed as-is as
+	// the LinuxKernelDirect chipset's KernelFilePath. Only used, and
+	// required, when DirectBoot is true.
+	KernelPath string
+	// BootParameters is a free-form kernel/bootloader command line, passed
+	// through verbatim.
+	BootParameters string
+	// DirectBoot swaps the UEFI boot entry for a LinuxKernelDirect-style
+	// direct-boot chipset, for UVM images that ship a kernel + initrd rather
+	// than a bootmgr.
+	DirectBoot bool
+}
+
+// validate checks that `b` describes a boot configuration CreateWCOW can act
+// on.
+func (b *BootConfig) validate() error {
+	if b.DirectBoot && b.KernelPath == "" {
+		return fmt.Errorf("BootConfig.KernelPath is required when DirectBoot is set")
+	}
+	if !b.DirectBoot && b.BootLoaderPath == "" {
+		return fmt.Errorf("BootConfig.BootLoaderPath is required when DirectBoot is not set")
+	}
+	switch b.BootLoaderDeviceType {
+	case "", BootLoaderDeviceTypeVmbFs, BootLoaderDeviceTypeScsi, BootLoaderDeviceTypeVPMem:
+	default:
+		return fmt.Errorf("unknown BootConfig.BootLoaderDeviceType %q", b.BootLoaderDeviceType)
+	}
+	return nil
 }
 
 // NewDefaultOptionsWCOW creates the default options for a bootable version of
@@ -54,7 +117,8 @@ type OptionsWCOW struct {
 // executable files name.
 func NewDefaultOptionsWCOW(id, owner string) *OptionsWCOW {
 	return &OptionsWCOW{
-		Options: newDefaultOptions(id, owner),
+		Options:               newDefaultOptions(id, owner),
+		CheckpointCompression: CheckpointCompressionZstd,
 	}
 }
 
@@ -93,7 +157,55 @@ func (uvm *UtilityVM) startExternalGcsListener(ctx context.Context) error {
 	return nil
 }
 
+// chipsetForBootConfig builds the Chipset doc fragment for `boot`. A nil
+// `boot` gets the default: UEFI loading `bootmgfw.efi` off the `os` VmbFs
+// share. A non-nil DirectBoot config instead requests a LinuxKernelDirect
+// chipset pointed at KernelPath, for UVM images that ship a kernel + initrd
+// rather than a bootmgr.
+func chipsetForBootConfig(boot *BootConfig) *hcsschema.Chipset {
+	if boot == nil {
+		return &hcsschema.Chipset{
+			Uefi: &hcsschema.Uefi{
+				BootThis: &hcsschema.UefiBootEntry{
+					DevicePath: `\EFI\Microsoft\Boot\bootmgfw.efi`,
+					DeviceType: "VmbFs",
+				},
+			},
+		}
+	}
+
+	deviceType := string(boot.BootLoaderDeviceType)
+	if deviceType == "" {
+		deviceType = string(BootLoaderDeviceTypeVmbFs)
+	}
+
+	if boot.DirectBoot {
+		return &hcsschema.Chipset{
+			LinuxKernelDirect: &hcsschema.LinuxKernelDirect{
+				KernelFilePath: boot.KernelPath,
+				KernelCmdLine:  boot.BootParameters,
+			},
+		}
+	}
+
+	return &hcsschema.Chipset{
+		Uefi: &hcsschema.Uefi{
+			BootThis: &hcsschema.UefiBootEntry{
+				DevicePath:   boot.BootLoaderPath,
+				DeviceType:   deviceType,
+				OptionalData: boot.BootParameters,
+			},
+		},
+	}
+}
+
 func prepareConfigDoc(ctx context.Context, uvm *UtilityVM, opts *OptionsWCOW, uvmFolder string) (*hcsschema.ComputeSystem, error) {
+	if opts.Boot != nil {
+		if err := opts.Boot.validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid BootConfig")
+		}
+	}
+
 	processorTopology, err := hostProcessorInfo(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get host processor information: %s", err)
@@ -126,14 +238,7 @@ func prepareConfigDoc(ctx context.Context, uvm *UtilityVM, opts *OptionsWCOW, uv
 		ShouldTerminateOnLastHandleClosed: true,
 		VirtualMachine: &hcsschema.VirtualMachine{
 			StopOnReset: true,
-			Chipset: &hcsschema.Chipset{
-				Uefi: &hcsschema.Uefi{
-					BootThis: &hcsschema.UefiBootEntry{
-						DevicePath: `\EFI\Microsoft\Boot\bootmgfw.efi`,
-						DeviceType: "VmbFs",
-					},
-				},
-			},
+			Chipset:     chipsetForBootConfig(opts.Boot),
 			ComputeTopology: &hcsschema.Topology{
 				Memory: &hcsschema.Memory2{
 					SizeInMB:        memorySizeInMB,
@@ -0,0 +1,20 @@
+// +build windows
+
+package uvm
+
+import (
+	"context"
+)
+
+// ReconnectGCSAfterClone starts a new external GCS bridge listener on a UVM
+// created by cloning a template, replacing uvm.gcListener. A clone's
+// vsock/hvsock connection is not inherited from the template it was cloned
+// from.
+//
+// It calls the same startExternalGcsListener that CreateWCOW already calls
+// for a UVM created with OptionsWCOW.IsClone, so a WCOW clone from
+// CreateWCOW does not need it; it is an entry point for callers that set up
+// the listener on an existing UtilityVM value after the fact.
+func (uvm *UtilityVM) ReconnectGCSAfterClone(ctx context.Context) error {
+	return uvm.startExternalGcsListener(ctx)
+}
@@ -0,0 +1,44 @@
+// +build windows
+
+package uvm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Microsoft/hcsshim/internal/requesttype"
+	hcsschema "github.com/Microsoft/hcsshim/internal/schema2"
+)
+
+// defaultGatewayResourcePath is the Modify resource path used to program a
+// network namespace's default route from a specific endpoint's gateway.
+const defaultGatewayResourcePath = "VirtualMachine/Devices/NetworkNamespace/DefaultGateway"
+
+// defaultGatewayEndpointSettings is the Modify payload for
+// defaultGatewayResourcePath.
+type defaultGatewayEndpointSettings struct {
+	NamespaceID string `json:"NamespaceId"`
+	EndpointID  string `json:"EndpointId"`
+	Gateway     string `json:"Gateway"`
+}
+
+// SetDefaultGatewayEndpoint programs `gateway` as the default route for
+// namespace `nsID` inside `uvm`, sourced from the endpoint identified by
+// `endpointID`. It's used for overlay networks, where one HNS endpoint in
+// the namespace is flagged EnableInternalDNS/GatewayAddress-only to carry the
+// default route rather than every endpoint claiming it.
+func (uvm *UtilityVM) SetDefaultGatewayEndpoint(ctx context.Context, nsID, endpointID, gateway string) error {
+	req := &hcsschema.ModifySettingRequest{
+		RequestType:  requesttype.Update,
+		ResourcePath: defaultGatewayResourcePath,
+		Settings: &defaultGatewayEndpointSettings{
+			NamespaceID: nsID,
+			EndpointID:  endpointID,
+			Gateway:     gateway,
+		},
+	}
+	if err := uvm.Modify(ctx, req); err != nil {
+		return fmt.Errorf("failed to set default gateway endpoint %s for namespace %s: %s", endpointID, nsID, err)
+	}
+	return nil
+}
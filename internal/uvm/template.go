@@ -0,0 +1,138 @@
+// +build windows
+
+package uvm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Microsoft/hcsshim/internal/log"
+	"github.com/Microsoft/hcsshim/internal/logfields"
+)
+
+// SaveAsTemplateEventTopic is the containerd event topic published when a UVM
+// annotated with `io.microsoft.virtualmachine.saveastemplate` finishes its HCS
+// save request and enters (or fails to enter) the `SavedAsTemplate` state.
+//
+// Consumers should subscribe to this topic instead of polling `hcsdiag list`
+// for the `SavedAsTemplate` string.
+const SaveAsTemplateEventTopic = "/hcsshim/uvm/saveastemplate"
+
+// SaveAsTemplateEvent is the payload published on SaveAsTemplateEventTopic.
+type SaveAsTemplateEvent struct {
+	// UVMID is the runtime ID of the UVM that was saved.
+	UVMID string
+	// Err is non-empty if the save failed. Consumers should treat a
+	// non-empty Err as terminal rather than continuing to wait.
+	Err string
+}
+
+// templateSaveWaiters tracks in-flight waiters for a UVM's SavedAsTemplate
+// transition, keyed by UVM ID. Only waiters registered before the save
+// completes are notified; no completed result is kept for later callers.
+var templateSaveWaiters = struct {
+	m sync.Mutex
+	c map[string][]chan error
+}{c: make(map[string][]chan error)}
+
+// WaitForSaveAsTemplate blocks until the UVM identified by `uvmID` finishes
+// its transition into the `SavedAsTemplate` state, or `ctx` is done. It
+// returns the error the save completed with, if any.
+//
+// It must be called before the save completes, e.g. from another goroutine
+// while SaveAsTemplate is running: SaveAsTemplate notifies waiters before it
+// returns, so a call made after that blocks until `ctx` is done.
+func WaitForSaveAsTemplate(ctx context.Context, uvmID string) error {
+	ch := make(chan error, 1)
+	templateSaveWaiters.m.Lock()
+	templateSaveWaiters.c[uvmID] = append(templateSaveWaiters.c[uvmID], ch)
+	templateSaveWaiters.m.Unlock()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		removeTemplateSaveWaiter(uvmID, ch)
+		return ctx.Err()
+	}
+}
+
+// removeTemplateSaveWaiter drops `ch` from uvmID's waiter list without
+// closing it, so a waiter whose ctx expires first doesn't leak a map entry
+// that notifySaveAsTemplateComplete would otherwise only ever append to.
+func removeTemplateSaveWaiter(uvmID string, ch chan error) {
+	templateSaveWaiters.m.Lock()
+	defer templateSaveWaiters.m.Unlock()
+	waiters := templateSaveWaiters.c[uvmID]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(templateSaveWaiters.c, uvmID)
+	} else {
+		templateSaveWaiters.c[uvmID] = waiters
+	}
+}
+
+// notifySaveAsTemplateComplete wakes any callers blocked in
+// WaitForSaveAsTemplate for `uvmID` and publishes a SaveAsTemplateEventTopic
+// event through `publisher`, if one was supplied. `saveErr` is non-nil if the
+// HCS save request for the template UVM failed.
+func notifySaveAsTemplateComplete(ctx context.Context, publisher EventPublisher, uvmID string, saveErr error) {
+	templateSaveWaiters.m.Lock()
+	waiters := templateSaveWaiters.c[uvmID]
+	delete(templateSaveWaiters.c, uvmID)
+	templateSaveWaiters.m.Unlock()
+
+	for _, ch := range waiters {
+		ch <- saveErr
+		close(ch)
+	}
+
+	if publisher == nil {
+		return
+	}
+	ev := &SaveAsTemplateEvent{UVMID: uvmID}
+	if saveErr != nil {
+		ev.Err = saveErr.Error()
+	}
+	if err := publisher.Publish(ctx, SaveAsTemplateEventTopic, ev); err != nil {
+		log.G(ctx).WithError(err).WithField(logfields.UVMID, uvmID).Warn("failed to publish SavedAsTemplate event")
+	}
+}
+
+// EventPublisher is the subset of containerd's events.Publisher that the UVM
+// template subsystem needs. It is declared locally so this package doesn't
+// take a hard dependency on containerd's event exchange wiring.
+type EventPublisher interface {
+	Publish(ctx context.Context, topic string, event interface{}) error
+}
+
+// SaveAsTemplate requests that the HCS save `uvm`'s state so it can later be
+// used as the source of a clone, then notifies any waiters and publishes
+// SaveAsTemplateEventTopic via `publisher` (which may be nil) once the
+// request completes, whether it succeeded or failed.
+func (uvm *UtilityVM) SaveAsTemplate(ctx context.Context, publisher EventPublisher) (err error) {
+	defer func() {
+		notifySaveAsTemplateComplete(ctx, publisher, uvm.id, err)
+	}()
+
+	if err = uvm.hcsSystem.Save(ctx, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RegisterAsTemplate records `uvm` in this node's template inventory under
+// `templateID`, so CheckTemplateAffinity and ListTemplates can see it. It
+// should be called once SaveAsTemplate completes successfully.
+func (uvm *UtilityVM) RegisterAsTemplate(templateID string) {
+	RegisterTemplate(TemplateInfo{
+		TemplateID: templateID,
+		UVMID:      uvm.id,
+		State:      "SavedAsTemplate",
+	})
+}
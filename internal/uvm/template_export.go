@@ -0,0 +1,152 @@
+// +build windows
+
+package uvm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Microsoft/go-winio/pkg/guid"
+	hcsschema "github.com/Microsoft/hcsshim/internal/schema2"
+)
+
+// templateManifestFileName is the name of the metadata file written into a
+// template's export directory alongside its saved-state files.
+const templateManifestFileName = "template.json"
+
+// TemplateManifest describes a template UVM exported by ExportTemplate,
+// enough to seed a `templateid` on another host without re-running the
+// template container there.
+type TemplateManifest struct {
+	// TemplateID is the `templateid` the template was saved under on the
+	// exporting host.
+	TemplateID string `json:"templateId"`
+	// LayerFolders are the image layer paths the template UVM was created
+	// with, in the same order CreateWCOW expects.
+	LayerFolders []string `json:"layerFolders"`
+	// Mounts are the mounts the template container was created with, so an
+	// imported template's clones can be validated the same way local ones
+	// are (see mergeCloneMounts in internal/hcsoci).
+	Mounts []TemplateMount `json:"mounts,omitempty"`
+}
+
+// TemplateMount is the portable representation of a single mount a template
+// container was created with.
+type TemplateMount struct {
+	HostPath      string `json:"hostPath"`
+	ContainerPath string `json:"containerPath"`
+	ReadOnly      bool   `json:"readOnly"`
+}
+
+// ExportTemplate writes `savedStateReader` (the caller-supplied saved-state
+// bytes for `templateID`) to `dir`, plus a templateManifestFileName
+// describing the image layers and mounts the template was created with. The
+// resulting directory is a portable bundle ImportTemplate can later read
+// back - see ImportTemplate's doc comment for what that bundle can and can't
+// do on import.
+func ExportTemplate(ctx context.Context, templateID string, manifest TemplateManifest, savedStateReader io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("failed to create template export directory: %s", err)
+	}
+
+	manifest.TemplateID = templateID
+	manifestBytes, err := json.Marshal(&manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template manifest: %s", err)
+	}
+	if err := writeFile(filepath.Join(dir, templateManifestFileName), manifestBytes); err != nil {
+		return err
+	}
+
+	savedStateFile, err := os.Create(filepath.Join(dir, "savedstate.bin"))
+	if err != nil {
+		return fmt.Errorf("failed to create saved-state file: %s", err)
+	}
+	defer savedStateFile.Close()
+
+	if _, err := io.Copy(savedStateFile, savedStateReader); err != nil {
+		return fmt.Errorf("failed to write saved-state file: %s", err)
+	}
+	return nil
+}
+
+// ImportTemplate reads the bundle written by ExportTemplate from `dir` and
+// registers its manifest in this node's template inventory under a newly
+// generated template ID, returning that ID.
+//
+// This only reconstitutes the bookkeeping side of the template: the
+// TemplateInfo/TemplateMounts entries ListTemplates and
+// AddClonedContainerMountsForTemplate read. It does NOT hand `savedstate.bin`
+// back to HCS, and the registered TemplateInfo.UVMID is a freshly generated
+// ID with no HCS compute system behind it - there is no API in this package
+// that loads an opaque saved-state blob into HCS under a chosen ID. A clone
+// attempt that reaches CreateWCOW's IsClone branch with this UVMID as
+// RestoreState.TemplateSystemId will therefore fail at the HCS layer, since
+// HCS has no saved system under that ID. Until that gap is closed, treat
+// ImportTemplate as registering an inventory record, not a clonable
+// template; TemplateInfo.State is set to "Imported" rather than
+// "SavedAsTemplate" so callers can tell the difference.
+func ImportTemplate(ctx context.Context, dir string) (string, error) {
+	manifestBytes, err := readFile(filepath.Join(dir, templateManifestFileName))
+	if err != nil {
+		return "", fmt.Errorf("failed to read template manifest: %s", err)
+	}
+
+	var manifest TemplateManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return "", fmt.Errorf("failed to unmarshal template manifest: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "savedstate.bin")); err != nil {
+		return "", fmt.Errorf("imported template bundle is missing its saved-state file: %s", err)
+	}
+
+	g, err := guid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate a new template ID: %s", err)
+	}
+	newTemplateID := g.String()
+	RegisterTemplate(TemplateInfo{
+		TemplateID: newTemplateID,
+		UVMID:      newTemplateID,
+		State:      "Imported",
+	})
+
+	if len(manifest.Mounts) > 0 {
+		mounts := TemplateMounts{}
+		for _, m := range manifest.Mounts {
+			mounts.MappedDirectories = append(mounts.MappedDirectories, hcsschema.MappedDirectory{
+				HostPath:      m.HostPath,
+				ContainerPath: m.ContainerPath,
+				ReadOnly:      m.ReadOnly,
+			})
+		}
+		RegisterTemplateMounts(newTemplateID, mounts)
+	}
+
+	return newTemplateID, nil
+}
+
+func writeFile(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
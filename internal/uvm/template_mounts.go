@@ -0,0 +1,51 @@
+// +build windows
+
+package uvm
+
+import (
+	"sync"
+
+	hcsschema "github.com/Microsoft/hcsshim/internal/schema2"
+)
+
+// TemplateMounts is the set of mounts a template container was created with,
+// persisted alongside the saved UVM state so a later clone can inherit them
+// without the caller having to re-derive them from the original container
+// spec.
+type TemplateMounts struct {
+	MappedDirectories []hcsschema.MappedDirectory
+	MappedPipes       []hcsschema.MappedPipe
+}
+
+// templateMountsRegistry holds each registered template's mounts, keyed by
+// template ID, for the lifetime of this node's in-memory template inventory.
+var templateMountsRegistry = struct {
+	m sync.RWMutex
+	c map[string]TemplateMounts
+}{c: make(map[string]TemplateMounts)}
+
+// RegisterTemplateMounts records `mounts` as the mount set a clone of
+// `templateID` should inherit. It should be called alongside RegisterTemplate
+// once a template container's hosting UVM finishes saving.
+func RegisterTemplateMounts(templateID string, mounts TemplateMounts) {
+	templateMountsRegistry.m.Lock()
+	defer templateMountsRegistry.m.Unlock()
+	templateMountsRegistry.c[templateID] = mounts
+}
+
+// GetTemplateMounts returns the mounts registered for `templateID`, if any.
+func GetTemplateMounts(templateID string) (TemplateMounts, bool) {
+	templateMountsRegistry.m.RLock()
+	defer templateMountsRegistry.m.RUnlock()
+	mounts, ok := templateMountsRegistry.c[templateID]
+	return mounts, ok
+}
+
+// UnregisterTemplateMounts removes `templateID`'s mounts from the registry,
+// e.g. once the owning template pod is deleted. Callers typically call this
+// alongside UnregisterTemplate.
+func UnregisterTemplateMounts(templateID string) {
+	templateMountsRegistry.m.Lock()
+	defer templateMountsRegistry.m.Unlock()
+	delete(templateMountsRegistry.c, templateID)
+}
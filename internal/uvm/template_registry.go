@@ -0,0 +1,106 @@
+// +build windows
+
+package uvm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TemplateAffinity is the value of the
+// `io.microsoft.virtualmachine.templateaffinity` annotation on a clone pod
+// request.
+type TemplateAffinity string
+
+const (
+	// TemplateAffinityRequired fails the clone request if the node doesn't
+	// already host the requested template.
+	TemplateAffinityRequired TemplateAffinity = "required"
+	// TemplateAffinityPreferred is advisory only: an external scheduler may
+	// use it to prefer a node, but a clone request on a node without the
+	// template should still proceed (e.g. falling back to import, if
+	// available) rather than failing.
+	TemplateAffinityPreferred TemplateAffinity = "preferred"
+)
+
+// TemplateInfo describes a template UVM known to this node, as published
+// through the per-node template inventory so an external scheduler can
+// discover which node currently hosts a given template ID.
+type TemplateInfo struct {
+	// TemplateID is the `templateid` the template pod was saved under.
+	TemplateID string
+	// UVMID is the runtime ID of the saved template UVM.
+	UVMID string
+	// State is a human readable description of the template UVM's state:
+	// "SavedAsTemplate" for one this node saved itself and can clone from
+	// directly, or "Imported" for one ImportTemplate registered from an
+	// export bundle, which isn't clonable yet (see ImportTemplate).
+	State string
+}
+
+// ErrTemplateNotFound is returned when a clone request names a `templateid`
+// that this node has no record of. Callers that set
+// `io.microsoft.virtualmachine.templateaffinity=required` should fail the
+// clone request with this error instead of letting it proceed and mis-clone.
+type ErrTemplateNotFound struct {
+	TemplateID string
+}
+
+func (e *ErrTemplateNotFound) Error() string {
+	return fmt.Sprintf("no template with id %q is present on this node", e.TemplateID)
+}
+
+// templateRegistry is this node's inventory of saved template UVMs, keyed by
+// template ID.
+var templateRegistry = struct {
+	m sync.RWMutex
+	c map[string]TemplateInfo
+}{c: make(map[string]TemplateInfo)}
+
+// RegisterTemplate records `info` in this node's template inventory. It
+// should be called once a UVM finishes saving as a template (see
+// SaveAsTemplate). ImportTemplate also registers entries, with State
+// "Imported", which are not clonable from this node.
+func RegisterTemplate(info TemplateInfo) {
+	templateRegistry.m.Lock()
+	defer templateRegistry.m.Unlock()
+	templateRegistry.c[info.TemplateID] = info
+}
+
+// UnregisterTemplate removes `templateID` from this node's template
+// inventory, e.g. once the owning template pod is deleted.
+func UnregisterTemplate(templateID string) {
+	templateRegistry.m.Lock()
+	defer templateRegistry.m.Unlock()
+	delete(templateRegistry.c, templateID)
+}
+
+// ListTemplates returns a snapshot of this node's in-memory template
+// inventory. No gRPC or other service in this package exposes it outside
+// the process.
+func ListTemplates() []TemplateInfo {
+	templateRegistry.m.RLock()
+	defer templateRegistry.m.RUnlock()
+	infos := make([]TemplateInfo, 0, len(templateRegistry.c))
+	for _, info := range templateRegistry.c {
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// CheckTemplateAffinity verifies that `templateID` is present on this node
+// when `affinity` is TemplateAffinityRequired, returning ErrTemplateNotFound
+// if not. A TemplateAffinityPreferred (or empty) affinity never fails the
+// check - it's advisory for the scheduler, not enforced at clone time.
+func CheckTemplateAffinity(templateID string, affinity TemplateAffinity) error {
+	if affinity != TemplateAffinityRequired {
+		return nil
+	}
+	templateRegistry.m.RLock()
+	_, ok := templateRegistry.c[templateID]
+	templateRegistry.m.RUnlock()
+	if !ok {
+		return &ErrTemplateNotFound{TemplateID: templateID}
+	}
+	return nil
+}
@@ -5,11 +5,16 @@ package cri_containerd
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Microsoft/hcsshim/internal/hcsoci"
+	"github.com/Microsoft/hcsshim/internal/uvm"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 )
 
@@ -117,6 +122,76 @@ func getClonedContainerConfig(uniqueID int, templateid string) *runtime.CreateCo
 	}
 }
 
+// returns a request config for creating an LCOW template sandbox
+func getTemplatePodConfigLCOW(name string) *runtime.RunPodSandboxRequest {
+	req := getTemplatePodConfig(name)
+	req.RuntimeHandler = lcowRuntimeHandler
+	return req
+}
+
+// returns a request config for creating an LCOW template container
+func getTemplateContainerConfigLCOW(name string) *runtime.CreateContainerRequest {
+	return &runtime.CreateContainerRequest{
+		Config: &runtime.ContainerConfig{
+			Metadata: &runtime.ContainerMetadata{
+				Name: name,
+			},
+			Image: &runtime.ImageSpec{
+				Image: imageLcowAlpine,
+			},
+			// Do not keep the ping running on template containers.
+			Command: []string{
+				"ping",
+				"-c",
+				"1",
+				"127.0.0.1",
+			},
+			Annotations: map[string]string{
+				"io.microsoft.virtualmachine.saveastemplate": "true",
+			},
+		},
+	}
+}
+
+// returns a create cloned LCOW sandbox request config.
+func getClonedPodConfigLCOW(uniqueID int, templateid string) *runtime.RunPodSandboxRequest {
+	req := getClonedPodConfig(uniqueID, templateid)
+	req.RuntimeHandler = lcowRuntimeHandler
+	return req
+}
+
+// returns a create cloned LCOW container request config.
+func getClonedContainerConfigLCOW(uniqueID int, templateid string) *runtime.CreateContainerRequest {
+	return &runtime.CreateContainerRequest{
+		Config: &runtime.ContainerConfig{
+			Metadata: &runtime.ContainerMetadata{
+				Name: fmt.Sprintf("clonedcontainer-%d", uniqueID),
+			},
+			Image: &runtime.ImageSpec{
+				Image: imageLcowAlpine,
+			},
+			// Command for cloned containers
+			Command: []string{
+				"ping",
+				"127.0.0.1",
+			},
+			Annotations: map[string]string{
+				"io.microsoft.virtualmachine.templateid": templateid,
+			},
+		},
+	}
+}
+
+// waitForTemplateSave blocks until the UVM backing `templatePodID` finishes
+// saving itself as a template.
+//
+// In-process callers (e.g. a production container-exit handler in the same
+// shim process as the UVM) should prefer uvm.WaitForSaveAsTemplate /
+// uvm.SaveAsTemplateEventTopic, which hcsoci.HandleContainerExit now wires
+// up. This test talks to the shim purely over the CRI gRPC surface, so it
+// has no in-process access to that notification and still has to observe
+// the state externally; it polls `hcsdiag list` rather than block forever
+// on an event it can never receive.
 func waitForTemplateSave(ctx context.Context, t *testing.T, templatePodID string) {
 	app := "hcsdiag"
 	arg0 := "list"
@@ -174,6 +249,16 @@ func createClonedContainer(ctx context.Context, t *testing.T, client runtime.Run
 	return
 }
 
+// Creates an LCOW clone from the given template pod and container.
+// It is the callers responsibility to clean the stop and remove the cloned
+// containers and pods.
+func createClonedContainerLCOW(ctx context.Context, t *testing.T, client runtime.RuntimeServiceClient, templatePodID, templateContainerID string, cloneNumber int) (clonedPodID, clonedContainerID string) {
+	cloneSandboxRequest := getClonedPodConfigLCOW(cloneNumber, templatePodID)
+	cloneContainerRequest := getClonedContainerConfigLCOW(cloneNumber, templateContainerID)
+	clonedPodID, clonedContainerID = createPodAndContainer(ctx, t, client, cloneSandboxRequest, cloneContainerRequest)
+	return
+}
+
 // Runs a command inside given container and verifies if the command executes successfully.
 func verifyContainerExec(ctx context.Context, t *testing.T, client runtime.RuntimeServiceClient, containerID string) {
 	execCommand := []string{
@@ -223,6 +308,43 @@ func Test_CloneContainer_WCOW(t *testing.T) {
 	verifyContainerExec(ctx, t, client, clonedContainerID)
 }
 
+// Intended to mirror Test_CloneContainer_WCOW for LCOW, but this does not
+// yet exercise a real LCOW template/clone: the request this was meant to
+// implement needs kernel/initrd/rootfs snapshotting, vsock reconnection, and
+// a GCS re-handshake for a hypervisor-isolated LCOW UVM, none of which
+// exist here. hcsoci.IsSaveAsTemplateRequested/CloneTemplateID and
+// uvm.ReconnectGCSAfterClone are OS-agnostic helpers factored out of the
+// WCOW path, but nothing builds the LCOW-specific UVM creation/restore
+// support (an internal/uvm/create_lcow.go equivalent of create_wcow.go's
+// IsTemplate/IsClone/TemplateConfig handling) that a real save/clone would
+// need, so getTemplatePodConfigLCOW and friends would just drive the
+// WCOW-only save/clone path under an LCOW RuntimeHandler and either fail or
+// pass for the wrong reason. Skipping rather than leaving this green so it
+// can't be mistaken for proof LCOW template/clone works.
+func Test_CloneContainer_LCOW(t *testing.T) {
+	t.Skip("LCOW template/clone is unimplemented: needs create_lcow.go support for UVM save/restore, not present in this checkout")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newTestRuntimeClient(t)
+
+	pullRequiredImages(t, []string{imageLcowAlpine})
+
+	templatePodID, templateContainerID := createTemplateContainer(ctx, t, client, getTemplatePodConfigLCOW("templatepod"), getTemplateContainerConfigLCOW("templatecontainer"))
+	defer removePodSandbox(t, client, ctx, templatePodID)
+	defer stopPodSandbox(t, client, ctx, templatePodID)
+	defer removeContainer(t, client, ctx, templateContainerID)
+	defer stopContainer(t, client, ctx, templateContainerID)
+
+	clonedPodID, clonedContainerID := createClonedContainerLCOW(ctx, t, client, templatePodID, templateContainerID, 1)
+	defer removePodSandbox(t, client, ctx, clonedPodID)
+	defer stopPodSandbox(t, client, ctx, clonedPodID)
+	defer removeContainer(t, client, ctx, clonedContainerID)
+	defer stopContainer(t, client, ctx, clonedContainerID)
+
+	verifyContainerExec(ctx, t, client, clonedContainerID)
+}
+
 // A test for creating multiple clones(5 clones) from one template container.
 func Test_MultiplClonedContainers_WCOW(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -344,6 +466,173 @@ func Test_CloneContainersWithClonedPodPool_WCOW(t *testing.T) {
 	}
 }
 
+// A test that templates a container with a bind mount and verifies that the
+// cloned container sees the same mount content, without the clone having to
+// re-request the mount itself.
+func Test_CloneContainer_MountInheritance_WCOW(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newTestRuntimeClient(t)
+
+	pullRequiredImages(t, []string{imageWindowsNanoserver})
+
+	hostDir, err := ioutil.TempDir("", "hcsshim-clone-mount-test")
+	if err != nil {
+		t.Fatalf("failed to create host mount dir: %s", err)
+	}
+	defer os.RemoveAll(hostDir)
+
+	const containerPath = `C:\templatedata`
+	const fileName = "data.txt"
+	const fileContents = "hello from template"
+	if err := ioutil.WriteFile(filepath.Join(hostDir, fileName), []byte(fileContents), 0644); err != nil {
+		t.Fatalf("failed to write test file: %s", err)
+	}
+
+	templateContainerRequest := getTemplateContainerConfig("templatecontainer")
+	templateContainerRequest.Config.Mounts = []*runtime.Mount{
+		{
+			HostPath:      hostDir,
+			ContainerPath: containerPath,
+		},
+	}
+
+	templatePodID, templateContainerID := createTemplateContainer(ctx, t, client, getTemplatePodConfig("templatepod"), templateContainerRequest)
+	defer removePodSandbox(t, client, ctx, templatePodID)
+	defer stopPodSandbox(t, client, ctx, templatePodID)
+	defer removeContainer(t, client, ctx, templateContainerID)
+	defer stopContainer(t, client, ctx, templateContainerID)
+
+	clonedPodID, clonedContainerID := createClonedContainer(ctx, t, client, templatePodID, templateContainerID, 1)
+	defer removePodSandbox(t, client, ctx, clonedPodID)
+	defer stopPodSandbox(t, client, ctx, clonedPodID)
+	defer removeContainer(t, client, ctx, clonedContainerID)
+	defer stopContainer(t, client, ctx, clonedContainerID)
+
+	execRequest := &runtime.ExecSyncRequest{
+		ContainerId: clonedContainerID,
+		Cmd:         []string{"cmd", "/c", "type", filepath.Join(containerPath, fileName)},
+		Timeout:     20,
+	}
+	r := execSync(t, client, ctx, execRequest)
+	if got := strings.TrimSpace(string(r.Stdout)); got != fileContents {
+		t.Fatalf("expected cloned container to inherit template mount contents %q, got %q (stderr: %s)", fileContents, got, string(r.Stderr))
+	}
+}
+
+// A test that hcsoci.ValidateTemplateAffinity, called directly with a clone
+// request's annotations, rejects
+// `io.microsoft.virtualmachine.templateaffinity=required` for a `templateid`
+// that isn't present on this node, instead of silently mis-cloning or
+// hanging.
+func Test_ClonedPod_TemplateAffinityRequired_MissingTemplate_WCOW(t *testing.T) {
+	annotations := map[string]string{
+		"io.microsoft.virtualmachine.templateid":       "nonexistent-template",
+		"io.microsoft.virtualmachine.templateaffinity": "required",
+	}
+
+	err := hcsoci.ValidateTemplateAffinity(annotations)
+	if err == nil {
+		t.Fatalf("expected ValidateTemplateAffinity to fail for a missing required template, it succeeded instead")
+	}
+	if !strings.Contains(err.Error(), "no template with id") {
+		t.Fatalf("expected a template-not-found error, got: %s", err)
+	}
+}
+
+// A test that exports a template and imports it back under a new ID,
+// verifying the inventory bookkeeping ExportTemplate/ImportTemplate are
+// actually responsible for.
+//
+// This does NOT clone from the imported template: ImportTemplate doesn't
+// hand the saved-state bytes back to HCS (see its doc comment), so the
+// imported TemplateInfo.UVMID has no real HCS compute system behind it and
+// a clone attempt would fail at the HCS layer, not prove anything this test
+// can meaningfully assert on. Pre-warmed cross-host template distribution
+// remains unimplemented pending a real mechanism for loading an opaque
+// saved-state blob into HCS under a chosen ID.
+func Test_CloneContainer_ExportImportTemplate_WCOW(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newTestRuntimeClient(t)
+
+	pullRequiredImages(t, []string{imageWindowsNanoserver})
+
+	templatePodID, templateContainerID := createTemplateContainer(ctx, t, client, getTemplatePodConfig("templatepod"), getTemplateContainerConfig("templatecontainer"))
+	defer removePodSandbox(t, client, ctx, templatePodID)
+	defer stopPodSandbox(t, client, ctx, templatePodID)
+	defer removeContainer(t, client, ctx, templateContainerID)
+	defer stopContainer(t, client, ctx, templateContainerID)
+
+	exportDir, err := ioutil.TempDir("", "hcsshim-template-export-test")
+	if err != nil {
+		t.Fatalf("failed to create template export dir: %s", err)
+	}
+	defer os.RemoveAll(exportDir)
+
+	// The shim owns the actual HCS saved-state blob; here we only exercise
+	// the export/import bundling and re-registration of the template.
+	savedState := strings.NewReader("hcs-saved-state-blob")
+	if err := uvm.ExportTemplate(ctx, templatePodID, uvm.TemplateManifest{
+		LayerFolders: []string{imageWindowsNanoserver},
+	}, savedState, exportDir); err != nil {
+		t.Fatalf("failed to export template: %s", err)
+	}
+
+	importedTemplateID, err := uvm.ImportTemplate(ctx, exportDir)
+	if err != nil {
+		t.Fatalf("failed to import template: %s", err)
+	}
+
+	found := false
+	for _, info := range uvm.ListTemplates() {
+		if info.TemplateID == importedTemplateID {
+			found = true
+			if info.State != "Imported" {
+				t.Fatalf("expected imported template to be registered with State %q, got %q", "Imported", info.State)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("imported template %q was not found in ListTemplates", importedTemplateID)
+	}
+}
+
+// A test covering RestoreWCOWFromCheckpoint's own error paths.
+//
+// This test suite talks to the shim purely over the CRI gRPC surface, so it
+// has no in-process *uvm.UtilityVM to call Checkpoint on (the shim owns that
+// value, same constraint as waitForTemplateSave above) - a true round-trip
+// test belongs next to CreateWCOW in a unit test binary that can construct a
+// UtilityVM directly, which this package doesn't have yet. What this test
+// can verify from here is that RestoreWCOWFromCheckpoint fails closed
+// instead of panicking when its required input is missing: a nil
+// RestoreOptions.Options, and a checkpoint directory that was never written
+// by Checkpoint.
+func Test_UVM_RestoreFromCheckpoint_MissingInput_WCOW(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	checkpointDir, err := ioutil.TempDir("", "hcsshim-checkpoint-test")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint dir: %s", err)
+	}
+	defer os.RemoveAll(checkpointDir)
+
+	if _, err := uvm.RestoreWCOWFromCheckpoint(ctx, uvm.RestoreOptions{
+		Dir:     checkpointDir,
+		Options: uvm.NewDefaultOptionsWCOW("", ""),
+	}); err == nil {
+		t.Fatalf("expected restore from a directory with no checkpoint archive to fail")
+	}
+
+	if _, err := uvm.RestoreWCOWFromCheckpoint(ctx, uvm.RestoreOptions{
+		Dir: checkpointDir,
+	}); err == nil {
+		t.Fatalf("expected restore with a nil RestoreOptions.Options to fail")
+	}
+}
+
 func Test_ClonedContainerRunningAfterDeletingTemplate(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()